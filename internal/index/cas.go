@@ -0,0 +1,127 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrPreconditionFailed is returned by a Storage implementation's Put
+// method when the index has changed since it was last fetched (an
+// HTTP 412, or equivalent) so the caller knows to retry the mutation
+// against the newer version instead of clobbering it.
+var ErrPreconditionFailed = errors.New("index: precondition failed, index was modified concurrently")
+
+// Storage is the minimal interface UpdateFunc needs from wherever the
+// index actually lives (e.g. S3). Get must return the index bytes
+// together with an opaque version token (an ETag for S3); Put must
+// only succeed if the index still matches ifMatch, returning
+// ErrPreconditionFailed otherwise.
+type Storage interface {
+	Get(ctx context.Context) (data []byte, version string, err error)
+	Put(ctx context.Context, data []byte, ifMatch string) error
+}
+
+// Backoff controls the delay between UpdateFunc's retries. By default
+// the delay grows linearly with the attempt number (100ms per attempt);
+// it can be overridden for tests.
+var Backoff = func(attempt int) time.Duration {
+	return time.Duration(attempt) * 100 * time.Millisecond
+}
+
+// maxUpdateAttempts bounds how many times UpdateFunc retries a mutation
+// before giving up, so a permanently contended index can't wedge a push.
+const maxUpdateAttempts = 5
+
+// UpdateFunc performs an optimistic-concurrency update of an index held
+// in s: it loads the current index and its version token, applies
+// mutate, and writes the result back conditioned on that token. If the
+// index changed in between (ErrPreconditionFailed), it re-reads and
+// retries the mutation with a short backoff. This closes the race where
+// two concurrent `helm s3 push` invocations each read index.yaml, mutate
+// their own copy, and overwrite each other's changes.
+func UpdateFunc(ctx context.Context, s Storage, mutate func(*Index) error) error {
+	var lastErr error
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(Backoff(attempt)):
+			}
+		}
+
+		data, version, err := s.Get(ctx)
+		if err != nil {
+			return err
+		}
+
+		idx := New()
+		if len(data) > 0 {
+			if err := idx.UnmarshalBinary(data); err != nil {
+				return err
+			}
+		}
+
+		if err := mutate(idx); err != nil {
+			return err
+		}
+
+		out, err := idx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		err = s.Put(ctx, out, version)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+// UpdateKeyedFunc is UpdateFunc for a single key of a KeyedStorage: it
+// loads the object at key together with its version token, applies
+// mutate to the raw bytes, and writes the result back conditioned on
+// that token, retrying with backoff on ErrPreconditionFailed. It
+// returns the bytes that were ultimately written, so callers that need
+// to record a checksum of the written object (e.g. a shard manifest)
+// don't have to re-fetch or re-derive it.
+func UpdateKeyedFunc(ctx context.Context, s KeyedStorage, key string, mutate func(data []byte) ([]byte, error)) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(Backoff(attempt)):
+			}
+		}
+
+		data, version, err := s.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := mutate(data)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.Put(ctx, key, out, version)
+		if err == nil {
+			return out, nil
+		}
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return nil, err
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
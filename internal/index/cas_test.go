@@ -0,0 +1,89 @@
+package index
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+type fakeStorage struct {
+	data    []byte
+	version int
+	// failPuts is the number of Put calls that should fail with
+	// ErrPreconditionFailed before one is allowed to succeed.
+	failPuts int
+	puts     int
+}
+
+func (f *fakeStorage) Get(ctx context.Context) ([]byte, string, error) {
+	return f.data, versionString(f.version), nil
+}
+
+func (f *fakeStorage) Put(ctx context.Context, data []byte, ifMatch string) error {
+	f.puts++
+	if f.puts <= f.failPuts {
+		return ErrPreconditionFailed
+	}
+	if ifMatch != versionString(f.version) {
+		return ErrPreconditionFailed
+	}
+	f.data = data
+	f.version++
+	return nil
+}
+
+func versionString(v int) string {
+	return strconv.Itoa(v)
+}
+
+func TestUpdateFuncRetriesOnPreconditionFailed(t *testing.T) {
+	Backoff = func(attempt int) time.Duration { return 0 }
+
+	s := &fakeStorage{failPuts: 2}
+
+	err := UpdateFunc(context.Background(), s, func(idx *Index) error {
+		return idx.AddOrReplace(&chart.Metadata{Name: "mychart", Version: "1.0.0"}, "mychart-1.0.0.tgz", "", "", "deadbeef")
+	})
+	if err != nil {
+		t.Fatalf("expected UpdateFunc to succeed after retrying, got: %s", err)
+	}
+	if s.puts != 3 {
+		t.Fatalf("expected 3 Put attempts (2 failed + 1 success), got %d", s.puts)
+	}
+}
+
+func TestUpdateFuncExhaustsRetries(t *testing.T) {
+	Backoff = func(attempt int) time.Duration { return 0 }
+
+	s := &fakeStorage{failPuts: maxUpdateAttempts}
+
+	err := UpdateFunc(context.Background(), s, func(idx *Index) error {
+		return idx.AddOrReplace(&chart.Metadata{Name: "mychart", Version: "1.0.0"}, "mychart-1.0.0.tgz", "", "", "deadbeef")
+	})
+	if err == nil {
+		t.Fatal("expected UpdateFunc to give up and return an error")
+	}
+}
+
+func TestChecksumStableAcrossReindexWithNoChange(t *testing.T) {
+	idx := New()
+	md := &chart.Metadata{Name: "mychart", Version: "1.0.0"}
+	if err := idx.AddOrReplace(md, "mychart-1.0.0.tgz", "https://example.com/charts", "", "deadbeef"); err != nil {
+		t.Fatalf("AddOrReplace returned error: %s", err)
+	}
+
+	before := idx.Checksum()
+
+	// Simulate a reindex re-adding the same, unchanged chart version.
+	if err := idx.AddOrReplace(md, "mychart-1.0.0.tgz", "https://example.com/charts", "", "deadbeef"); err != nil {
+		t.Fatalf("AddOrReplace returned error: %s", err)
+	}
+
+	after := idx.Checksum()
+	if before != after {
+		t.Fatalf("expected checksum to be stable across a no-op reindex, got %q before and %q after", before, after)
+	}
+}
@@ -2,6 +2,8 @@ package index
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -17,6 +19,20 @@ import (
 // Index of a helm chart repository.
 type Index struct {
 	*repo.IndexFile
+
+	// InvalidEntries holds chart versions that were dropped while decoding
+	// the index because they failed validation. It is populated by
+	// UnmarshalBinary and is not itself persisted.
+	InvalidEntries []InvalidEntry `json:"-"`
+
+	// OCIRefs maps chart name -> version -> OCI artifact reference, for
+	// chart versions that were also pushed as OCI artifacts.
+	OCIRefs map[string]map[string]OCIRef `json:"ociRefs,omitempty"`
+
+	// ClientConfig configures the http.Client Verify uses to probe
+	// chart URLs. It is local configuration, not part of the index
+	// content, so it is never persisted.
+	ClientConfig ClientConfig `json:"-"`
 }
 
 // Reader returns io.Reader for index.
@@ -29,23 +45,110 @@ func (idx *Index) Reader() (io.Reader, error) {
 	return bytes.NewReader(b), nil
 }
 
-// MarshalBinary encodes index to a binary form.
+// MarshalBinary encodes index to a binary form. The encoding is
+// canonical: entries are sorted the same way SortEntries leaves them, so
+// two indexes with the same content always marshal to the same bytes.
+// This is what makes Checksum meaningful and lets `helm s3 reindex`
+// produce reproducible output.
 func (idx *Index) MarshalBinary() (data []byte, err error) {
+	if idx.IndexFile != nil {
+		idx.SortEntries()
+	}
 	return yaml.Marshal(idx)
 }
 
-// UnmarshalBinary decodes index from a binary form.
+// Checksum returns the hex-encoded sha256 of the index's canonical
+// encoding. Two indexes with identical entries and the same Generated
+// timestamp produce the same checksum regardless of the order charts
+// were added in, so it can be used to detect whether a push actually
+// changed anything. Generated is part of the encoding: indexes created
+// separately with New differ in checksum even when their entries match.
+func (idx *Index) Checksum() string {
+	b, err := idx.MarshalBinary()
+	if err != nil {
+		return ""
+	}
+
+	return checksumBytes(b)
+}
+
+// checksumBytes returns the hex-encoded sha256 of b.
+func checksumBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// UnmarshalBinary decodes index from a binary form. Chart versions that
+// fail validation are dropped rather than causing the whole index to be
+// rejected; they are recorded on InvalidEntries so callers can warn about
+// or quarantine them.
 func (idx *Index) UnmarshalBinary(data []byte) error {
 	i := &repo.IndexFile{}
 	if err := yaml.Unmarshal(data, i); err != nil {
 		return err
 	}
+
+	var invalid []InvalidEntry
+	for name, versions := range i.Entries {
+		var kept repo.ChartVersions
+		for _, v := range versions {
+			if err := validateMetadata(v.Metadata); err != nil {
+				invalid = append(invalid, InvalidEntry{
+					Name:    name,
+					Version: v.Version,
+					Reason:  err.Error(),
+				})
+				continue
+			}
+			kept = append(kept, v)
+		}
+		if len(kept) == 0 {
+			delete(i.Entries, name)
+			continue
+		}
+		i.Entries[name] = kept
+	}
+
 	i.SortEntries()
 
-	*idx = Index{IndexFile: i}
+	var aux struct {
+		OCIRefs map[string]map[string]OCIRef `json:"ociRefs,omitempty"`
+	}
+	if err := yaml.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	// Drop any OCIRefs pointing at a chart name/version that validation
+	// just dropped from i.Entries, so the two never disagree.
+	for name, versions := range aux.OCIRefs {
+		entryVersions, ok := i.Entries[name]
+		if !ok {
+			delete(aux.OCIRefs, name)
+			continue
+		}
+		for version := range versions {
+			if !hasVersion(entryVersions, version) {
+				delete(versions, version)
+			}
+		}
+		if len(versions) == 0 {
+			delete(aux.OCIRefs, name)
+		}
+	}
+
+	*idx = Index{IndexFile: i, InvalidEntries: invalid, OCIRefs: aux.OCIRefs}
 	return nil
 }
 
+func hasVersion(versions repo.ChartVersions, version string) bool {
+	for _, v := range versions {
+		if v.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
 // AddOrReplace is the same as Add but replaces the version if it exists instead
 // of adding it to the list of versions.
 func (idx *Index) AddOrReplace(md *chart.Metadata, filename, s3BaseURL, publishBaseURI, digest string) error {
@@ -53,6 +156,10 @@ func (idx *Index) AddOrReplace(md *chart.Metadata, filename, s3BaseURL, publishB
 	// Think how we can rework this in the future.
 	// Ref: https://github.com/kubernetes/helm/issues/3230
 
+	if err := validateMetadata(md); err != nil {
+		return fmt.Errorf("chart metadata is invalid: %s", err)
+	}
+
 	var s3url, url string
 	if publishBaseURI == "" {
 		publishBaseURI = s3BaseURL
@@ -102,6 +209,14 @@ func (idx *Index) AddOrReplace(md *chart.Metadata, filename, s3BaseURL, publishB
 		}
 
 		if chartSemVer.Equal(itemSemVer) {
+			// A reindex re-adds every chart version it finds in the
+			// bucket; if the content hasn't changed since the last time
+			// this version was indexed (same digest), keep the original
+			// Created timestamp so the canonical encoding - and thus
+			// Checksum - doesn't change for charts that didn't change.
+			if v.Digest == digest {
+				cr.Created = v.Created
+			}
 			idx.Entries[md.Name][i] = cr
 			return nil
 		}
@@ -112,6 +227,32 @@ func (idx *Index) AddOrReplace(md *chart.Metadata, filename, s3BaseURL, publishB
 	return nil
 }
 
+// findVersion returns the existing ChartVersion for name at version, or
+// nil if no such entry exists yet.
+func (idx *Index) findVersion(name, version string) (*repo.ChartVersion, error) {
+	entries, ok := idx.Entries[name]
+	if !ok {
+		return nil, nil
+	}
+
+	target, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range entries {
+		itemSemVer, err := semver.NewVersion(v.Version)
+		if err != nil {
+			continue
+		}
+		if target.Equal(itemSemVer) {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
+
 // Delete removes chart version from index and returns deleted item.
 func (idx *Index) Delete(name, version string) (*repo.ChartVersion, error) {
 	for chartName, chartVersions := range idx.Entries {
@@ -136,6 +277,6 @@ func (idx *Index) Delete(name, version string) (*repo.ChartVersion, error) {
 // New returns a new index.
 func New() *Index {
 	return &Index{
-		repo.NewIndexFile(),
+		IndexFile: repo.NewIndexFile(),
 	}
 }
@@ -0,0 +1,56 @@
+package index
+
+import (
+	"fmt"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// OCIRef records a chart version's OCI artifact location alongside its
+// tarball URLs/S3URLs.
+type OCIRef struct {
+	Ref    string `json:"ref"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// AddOrReplaceOCI records an OCI artifact reference for md's chart
+// version. If the version already has a tarball entry (from a prior
+// AddOrReplace), that entry's URLs/S3URLs are carried forward rather
+// than being blanked out, since AddOrReplace itself has no tarball URL
+// to set here.
+func (idx *Index) AddOrReplaceOCI(md *chart.Metadata, ociRef, digest string) error {
+	if err := validateMetadata(md); err != nil {
+		return fmt.Errorf("chart metadata is invalid: %s", err)
+	}
+	if ociRef == "" {
+		return fmt.Errorf("ociRef must not be empty")
+	}
+
+	existing, err := idx.findVersion(md.Name, md.Version)
+	if err != nil {
+		return err
+	}
+
+	if err := idx.AddOrReplace(md, "", "", "", digest); err != nil {
+		return err
+	}
+
+	if existing != nil {
+		cr, err := idx.findVersion(md.Name, md.Version)
+		if err != nil {
+			return err
+		}
+		cr.URLs = existing.URLs
+		cr.S3URLs = existing.S3URLs
+	}
+
+	if idx.OCIRefs == nil {
+		idx.OCIRefs = map[string]map[string]OCIRef{}
+	}
+	if idx.OCIRefs[md.Name] == nil {
+		idx.OCIRefs[md.Name] = map[string]OCIRef{}
+	}
+	idx.OCIRefs[md.Name][md.Version] = OCIRef{Ref: ociRef, Digest: digest}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package index
+
+import (
+	"testing"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+func TestAddOrReplaceOCIRoundTrip(t *testing.T) {
+	idx := New()
+	md := &chart.Metadata{Name: "mychart", Version: "1.0.0"}
+
+	err := idx.AddOrReplaceOCI(md, "oci://bucket.s3.us-east-1.amazonaws.com/charts/mychart@sha256:abc123", "sha256:abc123")
+	if err != nil {
+		t.Fatalf("AddOrReplaceOCI returned error: %s", err)
+	}
+
+	ref, ok := idx.OCIRefs["mychart"]["1.0.0"]
+	if !ok {
+		t.Fatal("expected OCIRefs to contain mychart 1.0.0")
+	}
+	if ref.Ref != "oci://bucket.s3.us-east-1.amazonaws.com/charts/mychart@sha256:abc123" {
+		t.Fatalf("unexpected ref: %s", ref.Ref)
+	}
+
+	data, err := idx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary returned error: %s", err)
+	}
+
+	roundTripped := New()
+	if err := roundTripped.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary returned error: %s", err)
+	}
+
+	rtRef, ok := roundTripped.OCIRefs["mychart"]["1.0.0"]
+	if !ok {
+		t.Fatal("expected OCIRefs to survive a marshal/unmarshal round trip")
+	}
+	if rtRef != ref {
+		t.Fatalf("expected round-tripped OCIRef to equal original, got %+v vs %+v", rtRef, ref)
+	}
+}
+
+func TestAddOrReplaceOCIPreservesExistingTarballURLs(t *testing.T) {
+	idx := New()
+	md := &chart.Metadata{Name: "mychart", Version: "1.0.0"}
+
+	if err := idx.AddOrReplace(md, "mychart-1.0.0.tgz", "https://example.com/charts", "", "deadbeef"); err != nil {
+		t.Fatalf("AddOrReplace returned error: %s", err)
+	}
+
+	if err := idx.AddOrReplaceOCI(md, "oci://bucket.s3.us-east-1.amazonaws.com/charts/mychart@sha256:abc123", "sha256:abc123"); err != nil {
+		t.Fatalf("AddOrReplaceOCI returned error: %s", err)
+	}
+
+	cv, err := idx.findVersion("mychart", "1.0.0")
+	if err != nil {
+		t.Fatalf("findVersion returned error: %s", err)
+	}
+	if cv == nil || len(cv.URLs) == 0 || cv.URLs[0] == "" {
+		t.Fatalf("expected tarball URL set by AddOrReplace to survive AddOrReplaceOCI, got %v", cv)
+	}
+	if cv.URLs[0] != "https://example.com/charts/mychart-1.0.0.tgz" {
+		t.Fatalf("unexpected URL: %s", cv.URLs[0])
+	}
+}
+
+func TestAddOrReplaceOCIRejectsEmptyRef(t *testing.T) {
+	idx := New()
+	md := &chart.Metadata{Name: "mychart", Version: "1.0.0"}
+
+	if err := idx.AddOrReplaceOCI(md, "", "sha256:abc123"); err == nil {
+		t.Fatal("expected AddOrReplaceOCI to reject an empty ociRef")
+	}
+}
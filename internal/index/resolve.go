@@ -0,0 +1,85 @@
+package index
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/repo"
+)
+
+// ConstraintError is returned by ResolveDependencies when a dependency's
+// version field is not a valid semver constraint.
+type ConstraintError struct {
+	Name       string
+	Constraint string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("dependency %q: invalid version constraint %q: %s", e.Name, e.Constraint, e.Err)
+}
+
+// NotFoundError is returned by ResolveDependencies when no version in
+// the index satisfies a dependency's constraint.
+type NotFoundError struct {
+	Name       string
+	Constraint string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("dependency %q: no version matching %q found in index", e.Name, e.Constraint)
+}
+
+// ResolveDependencies walks req.Dependencies and, for each one, finds
+// the highest version in idx.Entries that satisfies the dependency's
+// semver constraint (e.g. "~1.2", ">=1.0 <2.0"). Lookups are always by
+// Name; Alias is ignored here since it only affects how the caller
+// renders the result. Repository, when set, is matched against the
+// candidate's URLs/S3URLs so a dependency can pin to a specific mirror
+// if more than one is present.
+func (idx *Index) ResolveDependencies(req *chartutil.Requirements) ([]*repo.ChartVersion, error) {
+	resolved := make([]*repo.ChartVersion, 0, len(req.Dependencies))
+
+	for _, dep := range req.Dependencies {
+		constraint, err := semver.NewConstraint(dep.Version)
+		if err != nil {
+			return nil, &ConstraintError{Name: dep.Name, Constraint: dep.Version, Err: err}
+		}
+
+		var best *repo.ChartVersion
+		var bestVer *semver.Version
+		for _, cv := range idx.Entries[dep.Name] {
+			if dep.Repository != "" && !hasURLPrefix(cv, dep.Repository) {
+				continue
+			}
+
+			ver, err := semver.NewVersion(cv.Version)
+			if err != nil {
+				continue
+			}
+			if !constraint.Check(ver) {
+				continue
+			}
+			if best == nil || ver.GreaterThan(bestVer) {
+				best, bestVer = cv, ver
+			}
+		}
+
+		if best == nil {
+			return nil, &NotFoundError{Name: dep.Name, Constraint: dep.Version}
+		}
+		resolved = append(resolved, best)
+	}
+
+	return resolved, nil
+}
+
+func hasURLPrefix(cv *repo.ChartVersion, prefix string) bool {
+	for _, u := range append(append([]string{}, cv.URLs...), cv.S3URLs...) {
+		if len(u) >= len(prefix) && u[:len(prefix)] == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package index
+
+import (
+	"testing"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+func addVersion(t *testing.T, idx *Index, name, version string) {
+	t.Helper()
+	md := &chart.Metadata{Name: name, Version: version}
+	if err := idx.AddOrReplace(md, name+"-"+version+".tgz", "https://example.com/charts", "", "digest-"+version); err != nil {
+		t.Fatalf("AddOrReplace(%s %s) returned error: %s", name, version, err)
+	}
+}
+
+func TestResolveDependenciesPicksHighestMatchingVersion(t *testing.T) {
+	idx := New()
+	addVersion(t, idx, "mychart", "1.0.0")
+	addVersion(t, idx, "mychart", "1.2.0")
+	addVersion(t, idx, "mychart", "1.5.0")
+	addVersion(t, idx, "mychart", "2.0.0")
+
+	req := &chartutil.Requirements{
+		Dependencies: []*chartutil.Dependency{
+			{Name: "mychart", Version: "~1.2"},
+		},
+	}
+
+	resolved, err := idx.ResolveDependencies(req)
+	if err != nil {
+		t.Fatalf("ResolveDependencies returned error: %s", err)
+	}
+	if len(resolved) != 1 || resolved[0].Version != "1.2.0" {
+		t.Fatalf("expected to resolve mychart to 1.2.0, got %v", resolved)
+	}
+}
+
+func TestResolveDependenciesInvalidConstraint(t *testing.T) {
+	idx := New()
+	addVersion(t, idx, "mychart", "1.0.0")
+
+	req := &chartutil.Requirements{
+		Dependencies: []*chartutil.Dependency{
+			{Name: "mychart", Version: "not-a-constraint"},
+		},
+	}
+
+	_, err := idx.ResolveDependencies(req)
+	if err == nil {
+		t.Fatal("expected an error for an invalid constraint")
+	}
+	if _, ok := err.(*ConstraintError); !ok {
+		t.Fatalf("expected a *ConstraintError, got %T: %s", err, err)
+	}
+}
+
+func TestResolveDependenciesMissingChart(t *testing.T) {
+	idx := New()
+
+	req := &chartutil.Requirements{
+		Dependencies: []*chartutil.Dependency{
+			{Name: "missing", Version: ">=1.0.0"},
+		},
+	}
+
+	_, err := idx.ResolveDependencies(req)
+	if err == nil {
+		t.Fatal("expected an error for a chart that isn't in the index")
+	}
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Fatalf("expected a *NotFoundError, got %T: %s", err, err)
+	}
+}
+
+// TestResolveDependenciesExcludesPrereleaseUnlessPermitted pins the
+// edge case called out in the backlog: a plain constraint like ">=1.0.0"
+// must not match a pre-release version, but a constraint that itself
+// mentions a pre-release (e.g. ">=1.0.0-0") must be able to.
+func TestResolveDependenciesExcludesPrereleaseUnlessPermitted(t *testing.T) {
+	idx := New()
+	addVersion(t, idx, "mychart", "1.0.0-beta.1")
+
+	req := &chartutil.Requirements{
+		Dependencies: []*chartutil.Dependency{
+			{Name: "mychart", Version: ">=1.0.0"},
+		},
+	}
+	if _, err := idx.ResolveDependencies(req); err == nil {
+		t.Fatal("expected plain >=1.0.0 constraint to exclude a 1.0.0-beta.1 pre-release version")
+	}
+
+	req = &chartutil.Requirements{
+		Dependencies: []*chartutil.Dependency{
+			{Name: "mychart", Version: ">=1.0.0-0"},
+		},
+	}
+	resolved, err := idx.ResolveDependencies(req)
+	if err != nil {
+		t.Fatalf("expected a constraint that explicitly permits pre-releases to match, got error: %s", err)
+	}
+	if len(resolved) != 1 || resolved[0].Version != "1.0.0-beta.1" {
+		t.Fatalf("expected to resolve mychart to 1.0.0-beta.1, got %v", resolved)
+	}
+}
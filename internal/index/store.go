@@ -0,0 +1,316 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/repo"
+)
+
+// IndexStore abstracts how the index is laid out in the backing bucket.
+// MonolithicStore keeps the classic single index.yaml; ShardedStore
+// splits it into one file per chart so a push only has to touch the
+// chart it changed instead of rewriting the whole (potentially
+// multi-MB) file.
+type IndexStore interface {
+	// Load returns the full, merged index.
+	Load(ctx context.Context) (*Index, error)
+
+	// Save persists the full index.
+	Save(ctx context.Context, idx *Index) error
+
+	// AddOrReplace adds or replaces a single chart version without
+	// requiring the caller to load and save the whole index.
+	AddOrReplace(ctx context.Context, md *chart.Metadata, filename, s3BaseURL, publishBaseURI, digest string) error
+
+	// Delete removes a single chart version.
+	Delete(ctx context.Context, name, version string) (*repo.ChartVersion, error)
+
+	// Merge returns a synthetic monolithic index assembled from
+	// whatever the store's underlying layout is, for clients that only
+	// speak the classic single-index.yaml protocol.
+	Merge(ctx context.Context) (*Index, error)
+}
+
+// KeyedStorage is Storage extended with a key, so a single bucket can
+// hold more than one object (a manifest plus per-chart shards).
+type KeyedStorage interface {
+	Get(ctx context.Context, key string) (data []byte, version string, err error)
+	Put(ctx context.Context, key string, data []byte, ifMatch string) error
+}
+
+// MonolithicStore is an IndexStore backed by the classic single
+// index.yaml object.
+type MonolithicStore struct {
+	Storage Storage
+}
+
+// Load implements IndexStore.
+func (s *MonolithicStore) Load(ctx context.Context) (*Index, error) {
+	data, _, err := s.Storage.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := New()
+	if len(data) > 0 {
+		if err := idx.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// Save implements IndexStore.
+func (s *MonolithicStore) Save(ctx context.Context, idx *Index) error {
+	return UpdateFunc(ctx, s.Storage, func(cur *Index) error {
+		*cur = *idx
+		return nil
+	})
+}
+
+// AddOrReplace implements IndexStore.
+func (s *MonolithicStore) AddOrReplace(ctx context.Context, md *chart.Metadata, filename, s3BaseURL, publishBaseURI, digest string) error {
+	return UpdateFunc(ctx, s.Storage, func(idx *Index) error {
+		return idx.AddOrReplace(md, filename, s3BaseURL, publishBaseURI, digest)
+	})
+}
+
+// Delete implements IndexStore.
+func (s *MonolithicStore) Delete(ctx context.Context, name, version string) (*repo.ChartVersion, error) {
+	var deleted *repo.ChartVersion
+	err := UpdateFunc(ctx, s.Storage, func(idx *Index) error {
+		var err error
+		deleted, err = idx.Delete(name, version)
+		return err
+	})
+	return deleted, err
+}
+
+// Merge implements IndexStore. The monolithic store has nothing to
+// merge, so it's equivalent to Load.
+func (s *MonolithicStore) Merge(ctx context.Context) (*Index, error) {
+	return s.Load(ctx)
+}
+
+// shardManifest is the small index.yaml written by ShardedStore in place
+// of the full index: it lists each chart's shard and the shard's
+// checksum, so clients can do conditional fetches
+// per shard instead of re-downloading everything.
+type shardManifest struct {
+	APIVersion string                 `json:"apiVersion"`
+	Shards     map[string]shardDigest `json:"shards"`
+}
+
+type shardDigest struct {
+	Checksum string `json:"checksum"`
+}
+
+const manifestKey = "index.yaml"
+
+func shardKey(chartName string) string {
+	return fmt.Sprintf("index/%s.yaml", chartName)
+}
+
+// ShardedStore is an IndexStore that keeps one index/<chart-name>.yaml
+// shard per chart plus a manifest at index.yaml listing the shards and
+// their checksums. A push only has to read and write the shard for the
+// chart being pushed (and the manifest), instead of the entire index.
+type ShardedStore struct {
+	Storage KeyedStorage
+}
+
+func (s *ShardedStore) loadManifest(ctx context.Context) (*shardManifest, string, error) {
+	data, version, err := s.Storage.Get(ctx, manifestKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	m := &shardManifest{APIVersion: "v1", Shards: map[string]shardDigest{}}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, m); err != nil {
+			return nil, "", err
+		}
+	}
+	return m, version, nil
+}
+
+func (s *ShardedStore) loadShard(ctx context.Context, chartName string) (*Index, error) {
+	data, _, err := s.Storage.Get(ctx, shardKey(chartName))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := New()
+	if len(data) > 0 {
+		if err := idx.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// mutateShard applies mutate to the shard for chartName under CAS: it
+// loads the shard with its version token, runs mutate, and writes the
+// result back conditioned on that token, retrying on
+// ErrPreconditionFailed. It returns the digest of the bytes that were
+// actually written, for the caller to record in the manifest.
+func (s *ShardedStore) mutateShard(ctx context.Context, chartName string, mutate func(*Index) error) (shardDigest, error) {
+	out, err := UpdateKeyedFunc(ctx, s.Storage, shardKey(chartName), func(data []byte) ([]byte, error) {
+		shard := New()
+		if len(data) > 0 {
+			if err := shard.UnmarshalBinary(data); err != nil {
+				return nil, err
+			}
+		}
+		if err := mutate(shard); err != nil {
+			return nil, err
+		}
+		return shard.MarshalBinary()
+	})
+	if err != nil {
+		return shardDigest{}, err
+	}
+	return shardDigest{Checksum: checksumBytes(out)}, nil
+}
+
+// mutateManifest applies mutate to the manifest under CAS, the same way
+// mutateShard does for a shard. Loading the manifest fresh on every
+// retry (rather than reusing a copy read earlier) is what lets two
+// concurrent pushes to different charts both land their shard entry
+// instead of one clobbering the other.
+func (s *ShardedStore) mutateManifest(ctx context.Context, mutate func(*shardManifest)) error {
+	_, err := UpdateKeyedFunc(ctx, s.Storage, manifestKey, func(data []byte) ([]byte, error) {
+		m := &shardManifest{APIVersion: "v1", Shards: map[string]shardDigest{}}
+		if len(data) > 0 {
+			if err := yaml.Unmarshal(data, m); err != nil {
+				return nil, err
+			}
+		}
+		mutate(m)
+		return yaml.Marshal(m)
+	})
+	return err
+}
+
+// Load implements IndexStore by merging every shard listed in the
+// manifest into a single index.
+func (s *ShardedStore) Load(ctx context.Context) (*Index, error) {
+	return s.Merge(ctx)
+}
+
+// Merge implements IndexStore.
+func (s *ShardedStore) Merge(ctx context.Context) (*Index, error) {
+	m, _, err := s.loadManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(m.Shards))
+	for name := range m.Shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	merged := New()
+	for _, name := range names {
+		shard, err := s.loadShard(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("loading shard %q: %s", name, err)
+		}
+		merged.InvalidEntries = append(merged.InvalidEntries, shard.InvalidEntries...)
+		for chartName, versions := range shard.Entries {
+			merged.Entries[chartName] = versions
+		}
+		if refs, ok := shard.OCIRefs[name]; ok {
+			if merged.OCIRefs == nil {
+				merged.OCIRefs = map[string]map[string]OCIRef{}
+			}
+			merged.OCIRefs[name] = refs
+		}
+	}
+
+	return merged, nil
+}
+
+// Save implements IndexStore by writing every chart in idx to its own
+// shard and rebuilding the manifest from scratch. Each shard and the
+// manifest are written through mutateShard/mutateManifest, so no single
+// write overwrites a concurrent write to the same object. The manifest's
+// shard list is replaced as a whole by the charts in idx, so a chart
+// that a concurrent AddOrReplace added and that is not in idx is
+// dropped from the manifest.
+func (s *ShardedStore) Save(ctx context.Context, idx *Index) error {
+	digests := map[string]shardDigest{}
+
+	for name, versions := range idx.Entries {
+		ociRefs := idx.OCIRefs[name]
+		digest, err := s.mutateShard(ctx, name, func(shard *Index) error {
+			shard.Entries[name] = versions
+			if ociRefs != nil {
+				if shard.OCIRefs == nil {
+					shard.OCIRefs = map[string]map[string]OCIRef{}
+				}
+				shard.OCIRefs[name] = ociRefs
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("saving shard %q: %s", name, err)
+		}
+		digests[name] = digest
+	}
+
+	return s.mutateManifest(ctx, func(m *shardManifest) {
+		m.Shards = digests
+	})
+}
+
+// AddOrReplace implements IndexStore by touching only the shard for
+// md.Name and the manifest, not the rest of the index. Both writes go
+// through CAS (mutateShard/mutateManifest), so a concurrent push to a
+// different chart can't clobber this one's manifest entry.
+func (s *ShardedStore) AddOrReplace(ctx context.Context, md *chart.Metadata, filename, s3BaseURL, publishBaseURI, digest string) error {
+	digestInfo, err := s.mutateShard(ctx, md.Name, func(shard *Index) error {
+		return shard.AddOrReplace(md, filename, s3BaseURL, publishBaseURI, digest)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mutateManifest(ctx, func(m *shardManifest) {
+		m.Shards[md.Name] = digestInfo
+	})
+}
+
+// Delete implements IndexStore by touching only the shard for name and
+// the manifest, both under CAS.
+func (s *ShardedStore) Delete(ctx context.Context, name, version string) (*repo.ChartVersion, error) {
+	var deleted *repo.ChartVersion
+	var remaining int
+
+	digestInfo, err := s.mutateShard(ctx, name, func(shard *Index) error {
+		d, err := shard.Delete(name, version)
+		if err != nil {
+			return err
+		}
+		deleted = d
+		remaining = len(shard.Entries[name])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mutateManifest(ctx, func(m *shardManifest) {
+		if remaining == 0 {
+			delete(m.Shards, name)
+		} else {
+			m.Shards[name] = digestInfo
+		}
+	})
+	return deleted, err
+}
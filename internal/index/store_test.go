@@ -0,0 +1,155 @@
+package index
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+type fakeKeyedStorage struct {
+	objects  map[string][]byte
+	versions map[string]int
+}
+
+func newFakeKeyedStorage() *fakeKeyedStorage {
+	return &fakeKeyedStorage{
+		objects:  map[string][]byte{},
+		versions: map[string]int{},
+	}
+}
+
+func (f *fakeKeyedStorage) Get(ctx context.Context, key string) ([]byte, string, error) {
+	return f.objects[key], strconv.Itoa(f.versions[key]), nil
+}
+
+func (f *fakeKeyedStorage) Put(ctx context.Context, key string, data []byte, ifMatch string) error {
+	if ifMatch != strconv.Itoa(f.versions[key]) {
+		return ErrPreconditionFailed
+	}
+	f.objects[key] = data
+	f.versions[key]++
+	return nil
+}
+
+func TestShardedStoreAddOrReplaceAndMerge(t *testing.T) {
+	Backoff = func(attempt int) time.Duration { return 0 }
+
+	store := &ShardedStore{Storage: newFakeKeyedStorage()}
+	ctx := context.Background()
+
+	err := store.AddOrReplace(ctx, &chart.Metadata{Name: "mychart", Version: "1.0.0"}, "mychart-1.0.0.tgz", "https://example.com/charts", "", "deadbeef")
+	if err != nil {
+		t.Fatalf("AddOrReplace returned error: %s", err)
+	}
+
+	merged, err := store.Merge(ctx)
+	if err != nil {
+		t.Fatalf("Merge returned error: %s", err)
+	}
+
+	versions, ok := merged.Entries["mychart"]
+	if !ok || len(versions) != 1 {
+		t.Fatalf("expected 1 version of mychart in merged index, got %v", merged.Entries)
+	}
+	if versions[0].Version != "1.0.0" {
+		t.Fatalf("expected version 1.0.0, got %s", versions[0].Version)
+	}
+}
+
+func TestShardedStoreDeleteRemovesEmptyShardFromManifest(t *testing.T) {
+	Backoff = func(attempt int) time.Duration { return 0 }
+
+	store := &ShardedStore{Storage: newFakeKeyedStorage()}
+	ctx := context.Background()
+
+	err := store.AddOrReplace(ctx, &chart.Metadata{Name: "mychart", Version: "1.0.0"}, "mychart-1.0.0.tgz", "https://example.com/charts", "", "deadbeef")
+	if err != nil {
+		t.Fatalf("AddOrReplace returned error: %s", err)
+	}
+
+	deleted, err := store.Delete(ctx, "mychart", "1.0.0")
+	if err != nil {
+		t.Fatalf("Delete returned error: %s", err)
+	}
+	if deleted == nil || deleted.Version != "1.0.0" {
+		t.Fatalf("expected deleted version 1.0.0, got %v", deleted)
+	}
+
+	m, _, err := store.loadManifest(ctx)
+	if err != nil {
+		t.Fatalf("loadManifest returned error: %s", err)
+	}
+	if _, ok := m.Shards["mychart"]; ok {
+		t.Fatalf("expected manifest to no longer list mychart after its last version was deleted")
+	}
+
+	merged, err := store.Merge(ctx)
+	if err != nil {
+		t.Fatalf("Merge returned error: %s", err)
+	}
+	if _, ok := merged.Entries["mychart"]; ok {
+		t.Fatalf("expected merged index to no longer contain mychart")
+	}
+}
+
+func TestShardedStoreSuccessiveAddOrReplaceDoNotClobberManifest(t *testing.T) {
+	Backoff = func(attempt int) time.Duration { return 0 }
+
+	store := &ShardedStore{Storage: newFakeKeyedStorage()}
+	ctx := context.Background()
+
+	if err := store.AddOrReplace(ctx, &chart.Metadata{Name: "chart-a", Version: "1.0.0"}, "chart-a-1.0.0.tgz", "https://example.com/charts", "", "a"); err != nil {
+		t.Fatalf("AddOrReplace chart-a returned error: %s", err)
+	}
+	if err := store.AddOrReplace(ctx, &chart.Metadata{Name: "chart-b", Version: "1.0.0"}, "chart-b-1.0.0.tgz", "https://example.com/charts", "", "b"); err != nil {
+		t.Fatalf("AddOrReplace chart-b returned error: %s", err)
+	}
+
+	m, _, err := store.loadManifest(ctx)
+	if err != nil {
+		t.Fatalf("loadManifest returned error: %s", err)
+	}
+	if _, ok := m.Shards["chart-a"]; !ok {
+		t.Fatalf("expected manifest to still list chart-a after a later push of chart-b")
+	}
+	if _, ok := m.Shards["chart-b"]; !ok {
+		t.Fatalf("expected manifest to list chart-b")
+	}
+}
+
+func TestShardedStoreSaveAndMergeRoundTripOCIRefs(t *testing.T) {
+	Backoff = func(attempt int) time.Duration { return 0 }
+
+	store := &ShardedStore{Storage: newFakeKeyedStorage()}
+	ctx := context.Background()
+
+	loaded, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("Load returned error: %s", err)
+	}
+
+	md := &chart.Metadata{Name: "mychart", Version: "1.0.0"}
+	if err := loaded.AddOrReplaceOCI(md, "oci://bucket.s3.us-east-1.amazonaws.com/charts/mychart@sha256:abc123", "sha256:abc123"); err != nil {
+		t.Fatalf("AddOrReplaceOCI returned error: %s", err)
+	}
+
+	if err := store.Save(ctx, loaded); err != nil {
+		t.Fatalf("Save returned error: %s", err)
+	}
+
+	merged, err := store.Merge(ctx)
+	if err != nil {
+		t.Fatalf("Merge returned error: %s", err)
+	}
+
+	ref, ok := merged.OCIRefs["mychart"]["1.0.0"]
+	if !ok {
+		t.Fatal("expected OCIRefs to survive a ShardedStore Save/Merge round trip")
+	}
+	if ref.Ref != "oci://bucket.s3.us-east-1.amazonaws.com/charts/mychart@sha256:abc123" {
+		t.Fatalf("unexpected ref: %s", ref.Ref)
+	}
+}
@@ -0,0 +1,134 @@
+package index
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultVerifyTimeout bounds how long a single HEAD request in Verify
+// may take when ClientConfig.Timeout isn't set, so one unreachable
+// mirror or a stalled TLS handshake can't hang the whole pass.
+const defaultVerifyTimeout = 10 * time.Second
+
+// ClientConfig configures the http.Client Verify builds to probe chart
+// URLs: a custom CA and/or client certificate for TLS/mTLS, and an
+// optional proxy.
+type ClientConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	Proxy              string
+
+	// Timeout bounds each probe request. Defaults to defaultVerifyTimeout
+	// when zero.
+	Timeout time.Duration
+}
+
+func (c *ClientConfig) httpClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if c.CAFile != "" {
+		pool, err := certPoolFromFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA file %q: %s", c.CAFile, err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy URL %q: %s", c.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultVerifyTimeout
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// VerifyResult reports whether a single chart version's primary URL
+// responded successfully to a HEAD request.
+type VerifyResult struct {
+	Name    string
+	Version string
+	URL     string
+	Err     error
+}
+
+// Verify performs a HEAD request against URLs[0] of every chart version
+// in the index, using an http.Client built from idx.ClientConfig, and
+// reports per-chart reachability.
+func (idx *Index) Verify(ctx context.Context) ([]VerifyResult, error) {
+	client, err := idx.ClientConfig.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []VerifyResult
+	for name, versions := range idx.Entries {
+		for _, cv := range versions {
+			res := VerifyResult{Name: name, Version: cv.Version}
+			if len(cv.URLs) == 0 || cv.URLs[0] == "" {
+				res.Err = fmt.Errorf("no URL recorded for %s %s", name, cv.Version)
+				results = append(results, res)
+				continue
+			}
+			res.URL = cv.URLs[0]
+
+			req, err := http.NewRequest(http.MethodHead, res.URL, nil)
+			if err != nil {
+				res.Err = err
+				results = append(results, res)
+				continue
+			}
+
+			resp, err := client.Do(req.WithContext(ctx))
+			if err != nil {
+				res.Err = err
+			} else {
+				resp.Body.Close()
+				if resp.StatusCode >= 400 {
+					res.Err = fmt.Errorf("unexpected status %s", resp.Status)
+				}
+			}
+			results = append(results, res)
+		}
+	}
+
+	return results, nil
+}
+
+func certPoolFromFile(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
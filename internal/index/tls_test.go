@@ -0,0 +1,30 @@
+package index
+
+import (
+	"testing"
+)
+
+func TestClientConfigHTTPClientDefaultTimeout(t *testing.T) {
+	c := &ClientConfig{}
+
+	client, err := c.httpClient()
+	if err != nil {
+		t.Fatalf("httpClient returned error: %s", err)
+	}
+	if client.Timeout != defaultVerifyTimeout {
+		t.Fatalf("expected default timeout %s, got %s", defaultVerifyTimeout, client.Timeout)
+	}
+}
+
+func TestClientConfigHTTPClientCustomTimeout(t *testing.T) {
+	want := defaultVerifyTimeout * 2
+	c := &ClientConfig{Timeout: want}
+
+	client, err := c.httpClient()
+	if err != nil {
+		t.Fatalf("httpClient returned error: %s", err)
+	}
+	if client.Timeout != want {
+		t.Fatalf("expected timeout %s, got %s", want, client.Timeout)
+	}
+}
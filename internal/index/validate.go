@@ -0,0 +1,59 @@
+package index
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/Masterminds/semver"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// InvalidEntry describes a chart version that was found in an index but
+// rejected during load because it did not pass validation.
+type InvalidEntry struct {
+	Name    string
+	Version string
+	Reason  string
+}
+
+// validateMetadata rejects a nil Metadata, a Version that isn't valid
+// semver, and non-printable characters in the name, version,
+// description, home, icon and appVersion fields. Other fields
+// (keywords, sources, maintainers and the rest) are not checked.
+func validateMetadata(md *chart.Metadata) error {
+	if md == nil {
+		return fmt.Errorf("chart metadata is nil")
+	}
+
+	if _, err := semver.NewVersion(md.Version); err != nil {
+		return fmt.Errorf("invalid version %q: %s", md.Version, err)
+	}
+
+	fields := map[string]string{
+		"name":        md.Name,
+		"version":     md.Version,
+		"description": md.Description,
+		"home":        md.Home,
+		"icon":        md.Icon,
+		"appVersion":  md.AppVersion,
+	}
+	for field, value := range fields {
+		if !isPrintable(value) {
+			return fmt.Errorf("%s contains non-printable characters", field)
+		}
+	}
+
+	return nil
+}
+
+// isPrintable reports whether s contains only graphic characters and
+// Unicode whitespace (space, newline, tab, carriage return and the like).
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if unicode.IsGraphic(r) || unicode.IsSpace(r) {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package index
+
+import (
+	"testing"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		md      *chart.Metadata
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			md:      &chart.Metadata{Name: "mychart", Version: "1.2.3"},
+			wantErr: false,
+		},
+		{
+			name:    "invalid semver",
+			md:      &chart.Metadata{Name: "mychart", Version: "not-a-version"},
+			wantErr: true,
+		},
+		{
+			name:    "non-printable in description",
+			md:      &chart.Metadata{Name: "mychart", Version: "1.0.0", Description: "bad\x00value"},
+			wantErr: true,
+		},
+		{
+			name:    "nil metadata",
+			md:      nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMetadata(tt.md)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBinaryQuarantinesInvalidEntries(t *testing.T) {
+	data := []byte(`
+apiVersion: v1
+entries:
+  good:
+  - name: good
+    version: 1.0.0
+  bad:
+  - name: bad
+    version: not-a-version
+`)
+
+	idx := New()
+	if err := idx.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary returned error: %s", err)
+	}
+
+	if _, ok := idx.Entries["good"]; !ok {
+		t.Fatalf("expected valid chart %q to be kept", "good")
+	}
+	if _, ok := idx.Entries["bad"]; ok {
+		t.Fatalf("expected invalid chart %q to be dropped", "bad")
+	}
+
+	if len(idx.InvalidEntries) != 1 {
+		t.Fatalf("expected 1 invalid entry, got %d", len(idx.InvalidEntries))
+	}
+	if idx.InvalidEntries[0].Name != "bad" {
+		t.Fatalf("expected invalid entry for %q, got %q", "bad", idx.InvalidEntries[0].Name)
+	}
+}
+
+func TestUnmarshalBinaryPrunesOCIRefsForQuarantinedEntries(t *testing.T) {
+	data := []byte(`
+apiVersion: v1
+entries:
+  good:
+  - name: good
+    version: 1.0.0
+  bad:
+  - name: bad
+    version: not-a-version
+ociRefs:
+  good:
+    1.0.0:
+      ref: oci://bucket.s3.us-east-1.amazonaws.com/charts/good@sha256:abc123
+  bad:
+    not-a-version:
+      ref: oci://bucket.s3.us-east-1.amazonaws.com/charts/bad@sha256:def456
+`)
+
+	idx := New()
+	if err := idx.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary returned error: %s", err)
+	}
+
+	if _, ok := idx.OCIRefs["good"]["1.0.0"]; !ok {
+		t.Fatal("expected OCIRefs for the valid, kept chart version to survive")
+	}
+	if _, ok := idx.OCIRefs["bad"]; ok {
+		t.Fatal("expected OCIRefs for the quarantined chart to be pruned")
+	}
+}
+
+func TestAddOrReplaceRejectsInvalidMetadata(t *testing.T) {
+	idx := New()
+	err := idx.AddOrReplace(&chart.Metadata{Name: "mychart", Version: "nope"}, "mychart-nope.tgz", "", "", "deadbeef")
+	if err == nil {
+		t.Fatal("expected AddOrReplace to reject invalid metadata")
+	}
+}